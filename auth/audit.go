@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry is a single recorded docker command execution.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	UserID    string    `json:"user_id"`
+	ChatID    string    `json:"chat_id"`
+	Command   string    `json:"command"`
+	Container string    `json:"container,omitempty"`
+}
+
+// AuditLogger appends audit entries to a JSONL file, rotating it out to a
+// timestamped sibling once it grows past maxBytes.
+type AuditLogger struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+}
+
+// NewAuditLogger returns a logger writing to path.
+func NewAuditLogger(path string, maxBytes int64) *AuditLogger {
+	return &AuditLogger{path: path, maxBytes: maxBytes}
+}
+
+// Log appends one entry, rotating the file first if needed.
+func (a *AuditLogger) Log(userID, chatID string, command, container string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.rotateIfNeeded(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := json.Marshal(AuditEntry{
+		Time:      time.Now(),
+		UserID:    userID,
+		ChatID:    chatID,
+		Command:   command,
+		Container: container,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+func (a *AuditLogger) rotateIfNeeded() error {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Size() < a.maxBytes {
+		return nil
+	}
+	rotated := fmt.Sprintf("%s.%d", a.path, time.Now().Unix())
+	return os.Rename(a.path, rotated)
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// BanEntry records a banned chat user. UserID is a backend-native identifier
+// rendered as a string (a Telegram user id, an XMPP JID, ...).
+type BanEntry struct {
+	UserID string    `json:"user_id"`
+	Until  time.Time `json:"until,omitempty"` // zero value means permanent
+	Reason string    `json:"reason,omitempty"`
+}
+
+// BanList is an in-memory ban table backed by a JSON file on disk.
+type BanList struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]BanEntry
+}
+
+// NewBanList loads an existing ban list from path, or starts an empty one
+// if the file does not exist yet.
+func NewBanList(path string) (*BanList, error) {
+	b := &BanList{
+		path:    path,
+		entries: make(map[string]BanEntry),
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return b, nil
+		}
+		return nil, err
+	}
+	if len(data) == 0 {
+		return b, nil
+	}
+	var entries []BanEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		b.entries[e.UserID] = e
+	}
+	return b, nil
+}
+
+func (b *BanList) save() error {
+	entries := make([]BanEntry, 0, len(b.entries))
+	for _, e := range b.entries {
+		entries = append(entries, e)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.path, data, 0644)
+}
+
+// Ban adds or replaces a ban entry for userID. A zero duration bans permanently.
+func (b *BanList) Ban(userID string, duration time.Duration, reason string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var until time.Time
+	if duration > 0 {
+		until = time.Now().Add(duration)
+	}
+	b.entries[userID] = BanEntry{
+		UserID: userID,
+		Until:  until,
+		Reason: reason,
+	}
+	return b.save()
+}
+
+// Unban removes a ban entry by user id. It is not an error to unban a user
+// who was never banned.
+func (b *BanList) Unban(userID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, userID)
+	return b.save()
+}
+
+// IsBanned reports whether userID is currently banned, lazily clearing the
+// entry once its expiry has passed.
+func (b *BanList) IsBanned(userID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.entries[userID]
+	if !ok {
+		return false
+	}
+	if !e.Until.IsZero() && time.Now().After(e.Until) {
+		delete(b.entries, userID)
+		_ = b.save()
+		return false
+	}
+	return true
+}
+
+// BanQuery is a parsed /ban or /unban command, targeting a user id.
+type BanQuery struct {
+	UserID   string
+	Duration time.Duration
+}
+
+// ParseBanQuery parses the arguments following /ban or /unban, e.g.
+// ["user", "12345", "1h"].
+func ParseBanQuery(args []string) (BanQuery, error) {
+	if len(args) < 2 {
+		return BanQuery{}, fmt.Errorf("usage: user <id> [duration]")
+	}
+	switch args[0] {
+	case "user":
+		q := BanQuery{UserID: args[1]}
+		if len(args) > 2 {
+			d, err := time.ParseDuration(args[2])
+			if err != nil {
+				return BanQuery{}, fmt.Errorf("invalid duration %q: %w", args[2], err)
+			}
+			q.Duration = d
+		}
+		return q, nil
+	case "name":
+		// name lookup was dropped: there's no reliable username->id mapping to
+		// resolve it against, so a name-targeted ban could never be tied to a
+		// stable identity. Ban by user id instead.
+		return BanQuery{}, fmt.Errorf("ban by name is not supported, use: user <id> [duration]")
+	default:
+		return BanQuery{}, fmt.Errorf("unknown ban target %q, expected user", args[0])
+	}
+}
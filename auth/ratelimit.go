@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket tracks the remaining command budget for a single user.
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// RateLimiter throttles commands per chat user using a token bucket, so a
+// compromised or noisy chat can't spam commands like /restart.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	rate    float64 // tokens regained per second
+	burst   float64 // bucket capacity
+}
+
+// NewRateLimiter allows up to burst commands per window, refilling smoothly
+// in between.
+func NewRateLimiter(burst int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		rate:    float64(burst) / window.Seconds(),
+		burst:   float64(burst),
+	}
+}
+
+// Allow reports whether userID may execute a command now, consuming a token
+// if so.
+func (r *RateLimiter) Allow(userID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	b, ok := r.buckets[userID]
+	if !ok {
+		b = &tokenBucket{tokens: r.burst, lastRefill: now}
+		r.buckets[userID] = b
+	}
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	b.tokens = math.Min(r.burst, b.tokens+elapsed*r.rate)
+	b.lastRefill = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -2,299 +2,104 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
-	"slices"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/go-telegram/bot"
-	"github.com/go-telegram/bot/models"
-	"github.com/go-telegram/ui/keyboard/reply"
-	"github.com/joho/godotenv"
-	"github.com/pgulb/docker-chatops/docker"
+	"github.com/pgulb/docker-chatops/auth"
+	"github.com/pgulb/docker-chatops/chatops"
+	"github.com/pgulb/docker-chatops/chatops/telegram"
+	"github.com/pgulb/docker-chatops/chatops/xmpp"
 )
 
-const botVersion = "v1.1.3"
-
-var allowedChatIds []int64
-var logsReplyKeyboard *reply.ReplyKeyboard
-var restartReplyKeyboard *reply.ReplyKeyboard
-
-func message(text string, b *bot.Bot, ctx context.Context, chatId int64) error {
-	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: chatId,
-		Text:   text,
-	})
-	if err != nil {
-		return err
-	}
-	return nil
-}
+const (
+	defaultRateLimitPerMinute = 5
+	defaultBanListPath        = "bans.json"
+	defaultAuditLogPath       = "audit.log"
+	defaultAuditLogMaxBytes   = 10 * 1024 * 1024
+)
 
-func messageAll(text string, b *bot.Bot, ctx context.Context) error {
-	for _, chatId := range allowedChatIds {
-		err := message(text, b, ctx, chatId)
-		if err != nil {
-			return err
-		}
+func rateLimitPerMinute() int {
+	raw := os.Getenv("RATE_LIMIT_PER_MINUTE")
+	if raw == "" {
+		return defaultRateLimitPerMinute
 	}
-	return nil
-}
-
-func logMessage(next bot.HandlerFunc) bot.HandlerFunc {
-	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
-		if update.Message != nil {
-			log.Printf("%d say: %s", update.Message.From.ID, update.Message.Text)
-		}
-		next(ctx, b, update)
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Println("RATE_LIMIT_PER_MINUTE invalid, using default")
+		return defaultRateLimitPerMinute
 	}
+	return n
 }
 
-func loadDotenv() string {
-	err := godotenv.Load(".env")
-	if err != nil {
-		log.Fatal(err)
+func followMaxDuration() time.Duration {
+	raw := os.Getenv("FOLLOW_MAX_DURATION")
+	if raw == "" {
+		return chatops.DefaultFollowMaxDuration
 	}
-	token := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if token == "" {
-		log.Fatal("TELEGRAM_BOT_TOKEN is empty")
-	}
-	allowedChatIdsCommas := os.Getenv("ALLOWED_CHAT_IDS")
-	if allowedChatIdsCommas == "" {
-		log.Println("ALLOWED_CHAT_IDS is empty")
-		allowedChatIds = []int64{}
-	} else {
-		allowedChatIdsStr := strings.Split(allowedChatIdsCommas, ",")
-		for _, chatIdStr := range allowedChatIdsStr {
-			chatId, err := strconv.ParseInt(chatIdStr, 10, 64)
-			if err != nil {
-				log.Fatal(err)
-			}
-			allowedChatIds = append(allowedChatIds, chatId)
-		}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Println("FOLLOW_MAX_DURATION invalid, using default")
+		return chatops.DefaultFollowMaxDuration
 	}
-	return token
+	return d
 }
 
-func main() {
-	token := loadDotenv()
-
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{
-		InsecureSkipVerify: true}
-
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer cancel()
-	opts := []bot.Option{
-		bot.WithMiddlewares(logMessage),
-	}
-	b, err := bot.New(token, opts...)
-	if nil != err {
-		log.Fatal(err)
-	}
-
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/ps", bot.MatchTypeExact, ps)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/logs", bot.MatchTypeExact, logs)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/restart", bot.MatchTypeExact, restart)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/images", bot.MatchTypeExact, images)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/version", bot.MatchTypeExact, version)
-
-	log.Println("docker-chatops version: " + botVersion)
-	log.Println("*** Chatops bot started ***")
-	messageAll("*Chatops bot started*", b, ctx)
-	b.Start(ctx)
-}
-
-func ps(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if !slices.Contains(allowedChatIds, update.Message.Chat.ID) {
-		log.Println("Unauthorized access blocked")
-		return
-	}
-	resp, err := docker.ListContainers(ctx)
-	if err != nil {
-		log.Println(err.Error())
-		message(err.Error(), b, ctx, update.Message.Chat.ID)
-	} else {
-		err = message(resp, b, ctx, update.Message.Chat.ID)
+// newBackend builds the chatops.Backend selected by CHAT_BACKEND
+// (telegram|xmpp, defaulting to telegram), along with the user ids allowed
+// to run /ban and /unban.
+func newBackend() (chatops.Backend, []string, error) {
+	switch os.Getenv("CHAT_BACKEND") {
+	case "xmpp":
+		b, err := xmpp.New()
 		if err != nil {
-			log.Println(err.Error())
+			return nil, nil, err
 		}
-	}
-}
-
-func initLogKeyboard(b *bot.Bot, ctx context.Context) error {
-	logsReplyKeyboard = reply.New(
-		b,
-		reply.WithPrefix("logs_keyboard"),
-		reply.IsSelective(),
-		reply.IsOneTimeKeyboard(),
-	)
-	ctr, err := docker.ListContainersNamesOnly(ctx)
-	if err != nil {
-		return err
-	}
-	for _, name := range ctr {
-		logsReplyKeyboard.Button(fmt.Sprintf("Logs %v", name),
-			b, bot.MatchTypeExact, onReplyLogs)
-		logsReplyKeyboard.Row()
-	}
-	logsReplyKeyboard.Button("Cancel Logs", b, bot.MatchTypeExact, onReplyLogs)
-	return nil
-}
-
-func logs(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if !slices.Contains(allowedChatIds, update.Message.Chat.ID) {
-		log.Println("Unauthorized access blocked")
-		return
-	}
-	err := initLogKeyboard(b, ctx)
-	if err != nil {
-		log.Println(err.Error())
-		message(err.Error(), b, ctx, update.Message.Chat.ID)
-		return
-	}
-	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID:      update.Message.Chat.ID,
-		Text:        "Select container:",
-		ReplyMarkup: logsReplyKeyboard,
-	})
-	if err != nil {
-		log.Println(err.Error())
-	}
-}
-
-func onReplyLogs(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if !slices.Contains(allowedChatIds, update.Message.Chat.ID) {
-		log.Println("Unauthorized access blocked")
-		return
-	}
-	if update.Message.Text == "Cancel Logs" {
-		err := message("Cancelled.", b, ctx, update.Message.Chat.ID)
+		var admins []string
+		if raw := os.Getenv("XMPP_ADMIN_JIDS"); raw != "" {
+			admins = strings.Split(raw, ",")
+		}
+		return b, admins, nil
+	case "telegram", "":
+		b, err := telegram.New()
 		if err != nil {
-			log.Println(err.Error())
+			return nil, nil, err
 		}
-		return
-	}
-	if strings.HasPrefix(update.Message.Text, "Logs ") {
-		resp, err := docker.TailLogs(ctx, strings.Split(update.Message.Text, " ")[1])
+		admins, err := telegram.AdminUserIDs()
 		if err != nil {
-			log.Println(err.Error())
-			message(err.Error(), b, ctx, update.Message.Chat.ID)
-		} else {
-			err = message(resp, b, ctx, update.Message.Chat.ID)
-			if err != nil {
-				log.Println(err.Error())
-			}
+			return nil, nil, err
 		}
+		return b, admins, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown CHAT_BACKEND %q, expected telegram or xmpp", os.Getenv("CHAT_BACKEND"))
 	}
 }
 
-func initRestartKeyboard(b *bot.Bot, ctx context.Context) error {
-	restartReplyKeyboard = reply.New(
-		b,
-		reply.WithPrefix("restart_keyboard"),
-		reply.IsSelective(),
-		reply.IsOneTimeKeyboard(),
-	)
-	ctr, err := docker.ListContainersNamesOnly(ctx)
+func main() {
+	backend, adminUserIDs, err := newBackend()
 	if err != nil {
-		return err
-	}
-	for _, name := range ctr {
-		restartReplyKeyboard.Button(fmt.Sprintf("Restart %v", name),
-			b, bot.MatchTypeExact, onReplyRestart)
-		restartReplyKeyboard.Row()
+		log.Fatal(err)
 	}
-	restartReplyKeyboard.Button("Cancel Restart", b, bot.MatchTypeExact, onReplyRestart)
-	return nil
-}
 
-func restart(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if !slices.Contains(allowedChatIds, update.Message.Chat.ID) {
-		log.Println("Unauthorized access blocked")
-		return
-	}
-	err := initRestartKeyboard(b, ctx)
-	if err != nil {
-		log.Println(err.Error())
-		message(err.Error(), b, ctx, update.Message.Chat.ID)
-		return
-	}
-	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID:      update.Message.Chat.ID,
-		Text:        "Select container:",
-		ReplyMarkup: restartReplyKeyboard,
-	})
+	banList, err := auth.NewBanList(defaultBanListPath)
 	if err != nil {
-		log.Println(err.Error())
+		log.Fatal(err)
 	}
-}
+	rateLimiter := auth.NewRateLimiter(rateLimitPerMinute(), time.Minute)
+	auditLogger := auth.NewAuditLogger(defaultAuditLogPath, defaultAuditLogMaxBytes)
 
-func onReplyRestart(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if !slices.Contains(allowedChatIds, update.Message.Chat.ID) {
-		log.Println("Unauthorized access blocked")
-		return
-	}
-	if update.Message.Text == "Cancel Restart" {
-		err := message("Cancelled.", b, ctx, update.Message.Chat.ID)
-		if err != nil {
-			log.Println(err.Error())
-		}
-		return
-	}
-	if strings.HasPrefix(update.Message.Text, "Restart ") {
-		resp, err := docker.RestartContainer(ctx, strings.Split(update.Message.Text, " ")[1])
-		if err != nil {
-			log.Println(err.Error())
-			message(err.Error(), b, ctx, update.Message.Chat.ID)
-		} else {
-			err = message(resp, b, ctx, update.Message.Chat.ID)
-			if err != nil {
-				log.Println(err.Error())
-			}
-		}
-	}
-}
+	registrar := chatops.NewRegistrar(backend, banList, rateLimiter, auditLogger, adminUserIDs, followMaxDuration())
+	registrar.Register()
 
-func images(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if !slices.Contains(allowedChatIds, update.Message.Chat.ID) {
-		log.Println("Unauthorized access blocked")
-		return
-	}
-	resp, err := docker.GetImages(ctx)
-	if err != nil {
-		log.Println(err.Error())
-		message(err.Error(), b, ctx, update.Message.Chat.ID)
-	} else {
-		err = message(resp, b, ctx, update.Message.Chat.ID)
-		if err != nil {
-			log.Println(err.Error())
-		}
-	}
-}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
 
-func version(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if !slices.Contains(allowedChatIds, update.Message.Chat.ID) {
-		log.Println("Unauthorized access blocked")
-		return
-	}
-	resp, err := docker.GetDockerVersion(ctx)
-	if err != nil {
-		log.Println(err.Error())
-		message(err.Error(), b, ctx, update.Message.Chat.ID)
-	} else {
-		resp := fmt.Sprintf(
-			"Bot version: %v\nDocker version specifics:\n%+v",
-			botVersion,
-			resp,
-		)
-		err = message(resp, b, ctx, update.Message.Chat.ID)
-		if err != nil {
-			log.Println(err.Error())
-		}
+	log.Println("docker-chatops version: " + chatops.BotVersion)
+	if err := backend.Start(ctx); err != nil {
+		log.Fatal(err)
 	}
 }
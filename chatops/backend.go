@@ -0,0 +1,50 @@
+// Package chatops defines the chat-transport abstraction docker-chatops'
+// command handlers run against, so the same handlers work unmodified over
+// Telegram, XMPP, or any future backend.
+package chatops
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrPromptCancelled is returned by Backend.PromptChoice when the user
+// cancels a choice prompt instead of picking one of the offered options.
+var ErrPromptCancelled = errors.New("chatops: prompt cancelled")
+
+// CommandHandler handles a single command invocation. chatID and userID are
+// backend-native identifiers rendered as strings (a Telegram chat id, an
+// XMPP JID, ...). args holds the whitespace-split words after the command
+// name, e.g. "/restart web" yields args = ["web"].
+type CommandHandler func(ctx context.Context, chatID string, userID string, args []string)
+
+// Backend is a chat transport the bot can run commands over. Every method
+// is safe to call concurrently.
+type Backend interface {
+	// SendMessage sends text to chatID and returns a backend-native message
+	// id, for backends that support editing messages later.
+	SendMessage(ctx context.Context, chatID string, text string) (messageID string, err error)
+
+	// EditMessage replaces the text of a previously sent message. Backends
+	// that cannot edit messages may instead send a new one and return its id.
+	EditMessage(ctx context.Context, chatID string, messageID string, text string) (newMessageID string, err error)
+
+	// RegisterCommand wires name (e.g. "/restart") to handler. Must be
+	// called before Start.
+	RegisterCommand(name string, handler CommandHandler)
+
+	// PromptChoice asks the user in chatID to pick one of options, blocking
+	// until they answer, ctx is cancelled, or the prompt's own timeout
+	// elapses. It returns ErrPromptCancelled if the user explicitly declines.
+	PromptChoice(ctx context.Context, chatID string, prompt string, options []string) (string, error)
+
+	// Authorize reports whether chatID may invoke commands at all. This is
+	// checked per chat, not per user, so a group chat listed in a backend's
+	// allow-list stays authorized regardless of which of its members speaks.
+	// Backends combine this with their own admin lists where relevant.
+	Authorize(chatID string) bool
+
+	// Start connects the backend and blocks, dispatching commands, until
+	// ctx is cancelled.
+	Start(ctx context.Context) error
+}
@@ -0,0 +1,453 @@
+package chatops
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pgulb/docker-chatops/auth"
+	"github.com/pgulb/docker-chatops/docker"
+)
+
+// BotVersion is the docker-chatops release running, reported by /version.
+const BotVersion = "v1.1.3"
+
+// DefaultFollowMaxDuration is how long a /follow session runs before it is
+// cut off when NewRegistrar is given a non-positive followMaxDuration.
+const DefaultFollowMaxDuration = 30 * time.Minute
+
+const (
+	followEditInterval = 3 * time.Second
+	followMessageLimit = 4096
+)
+
+// Registrar wires docker-chatops' commands onto a Backend, gating every one
+// of them through a shared ban list and rate limiter. Docker commands are
+// recorded in the audit log; /ban, /unban and /unfollow are not.
+type Registrar struct {
+	Backend      Backend
+	BanList      *auth.BanList
+	RateLimiter  *auth.RateLimiter
+	AuditLogger  *auth.AuditLogger
+	AdminUserIDs []string
+
+	// FollowMaxDuration caps how long a single /follow session runs before it
+	// is cut off; there is no Stop button (see follow's doc comment), so this
+	// is also the backstop against a forgotten session running forever.
+	FollowMaxDuration time.Duration
+
+	followSessionsMu sync.Mutex
+	followSessions   map[string]context.CancelFunc
+}
+
+// NewRegistrar builds a Registrar ready to have Register called on it.
+func NewRegistrar(b Backend, banList *auth.BanList, rateLimiter *auth.RateLimiter, auditLogger *auth.AuditLogger, adminUserIDs []string, followMaxDuration time.Duration) *Registrar {
+	if followMaxDuration <= 0 {
+		followMaxDuration = DefaultFollowMaxDuration
+	}
+	return &Registrar{
+		Backend:           b,
+		BanList:           banList,
+		RateLimiter:       rateLimiter,
+		AuditLogger:       auditLogger,
+		AdminUserIDs:      adminUserIDs,
+		FollowMaxDuration: followMaxDuration,
+		followSessions:    make(map[string]context.CancelFunc),
+	}
+}
+
+// Register wires every docker-chatops command onto the Registrar's Backend.
+func (r *Registrar) Register() {
+	r.Backend.RegisterCommand("/ps", r.guard(r.ps))
+	r.Backend.RegisterCommand("/logs", r.guard(r.logs))
+	r.Backend.RegisterCommand("/restart", r.guard(r.restart))
+	r.Backend.RegisterCommand("/images", r.guard(r.images))
+	r.Backend.RegisterCommand("/version", r.guard(r.version))
+	r.Backend.RegisterCommand("/ban", r.guard(r.ban))
+	r.Backend.RegisterCommand("/unban", r.guard(r.unban))
+	r.Backend.RegisterCommand("/follow", r.guard(r.follow))
+	r.Backend.RegisterCommand("/unfollow", r.guard(r.unfollow))
+	r.Backend.RegisterCommand("/stats", r.guard(r.stats))
+	r.Backend.RegisterCommand("/top", r.guard(r.top))
+	r.Backend.RegisterCommand("/stacks", r.guard(r.stacks))
+	r.Backend.RegisterCommand("/stackrestart", r.guard(r.stackRestart))
+	r.Backend.RegisterCommand("/stacklogs", r.guard(r.stackLogs))
+}
+
+// guard applies ban/rate-limit/authorization checks shared by every command,
+// regardless of which Backend is running it.
+func (r *Registrar) guard(handler CommandHandler) CommandHandler {
+	return func(ctx context.Context, chatID string, userID string, args []string) {
+		if !r.Backend.Authorize(chatID) {
+			log.Println("Unauthorized access blocked")
+			return
+		}
+		if r.BanList != nil && r.BanList.IsBanned(userID) {
+			log.Printf("Blocked command from banned user %v", userID)
+			return
+		}
+		if r.RateLimiter != nil && !r.RateLimiter.Allow(userID) {
+			r.reply(ctx, chatID, "Rate limit exceeded, please slow down.")
+			return
+		}
+		handler(ctx, chatID, userID, args)
+	}
+}
+
+func (r *Registrar) reply(ctx context.Context, chatID string, text string) {
+	if _, err := r.Backend.SendMessage(ctx, chatID, text); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func (r *Registrar) audit(userID, chatID, command, container string) {
+	if r.AuditLogger == nil {
+		return
+	}
+	if err := r.AuditLogger.Log(userID, chatID, command, container); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func (r *Registrar) ps(ctx context.Context, chatID string, userID string, args []string) {
+	resp, err := docker.ListContainers(ctx)
+	r.audit(userID, chatID, "/ps", "")
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	r.reply(ctx, chatID, resp)
+}
+
+func (r *Registrar) logs(ctx context.Context, chatID string, userID string, args []string) {
+	names, err := docker.ListContainersNamesOnly(ctx)
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	containerName, err := r.Backend.PromptChoice(ctx, chatID, "Select container:", names)
+	if err != nil {
+		if err != ErrPromptCancelled {
+			log.Println(err.Error())
+		}
+		return
+	}
+	resp, err := docker.TailLogs(ctx, containerName)
+	r.audit(userID, chatID, "/logs", containerName)
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	r.reply(ctx, chatID, resp)
+}
+
+func (r *Registrar) restart(ctx context.Context, chatID string, userID string, args []string) {
+	names, err := docker.ListContainersNamesOnly(ctx)
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	containerName, err := r.Backend.PromptChoice(ctx, chatID, "Select container:", names)
+	if err != nil {
+		if err != ErrPromptCancelled {
+			log.Println(err.Error())
+		}
+		return
+	}
+	resp, err := docker.RestartContainer(ctx, containerName)
+	r.audit(userID, chatID, "/restart", containerName)
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	r.reply(ctx, chatID, resp)
+}
+
+func (r *Registrar) images(ctx context.Context, chatID string, userID string, args []string) {
+	resp, err := docker.GetImages(ctx)
+	r.audit(userID, chatID, "/images", "")
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	r.reply(ctx, chatID, resp)
+}
+
+func (r *Registrar) version(ctx context.Context, chatID string, userID string, args []string) {
+	resp, err := docker.GetDockerVersion(ctx)
+	r.audit(userID, chatID, "/version", "")
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	r.reply(ctx, chatID, fmt.Sprintf("Bot version: %v\nDocker version specifics:\n%+v", BotVersion, resp))
+}
+
+func (r *Registrar) ban(ctx context.Context, chatID string, userID string, args []string) {
+	if !slices.Contains(r.AdminUserIDs, userID) {
+		log.Println("Unauthorized ban attempt blocked")
+		return
+	}
+	query, err := auth.ParseBanQuery(args)
+	if err != nil {
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	if err := r.BanList.Ban(query.UserID, query.Duration, ""); err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	r.reply(ctx, chatID, fmt.Sprintf("Banned user %v.", query.UserID))
+}
+
+func (r *Registrar) unban(ctx context.Context, chatID string, userID string, args []string) {
+	if !slices.Contains(r.AdminUserIDs, userID) {
+		log.Println("Unauthorized unban attempt blocked")
+		return
+	}
+	query, err := auth.ParseBanQuery(args)
+	if err != nil {
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	if err := r.BanList.Unban(query.UserID); err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	r.reply(ctx, chatID, fmt.Sprintf("Unbanned user %v.", query.UserID))
+}
+
+func (r *Registrar) stopFollow(chatID string) {
+	r.followSessionsMu.Lock()
+	defer r.followSessionsMu.Unlock()
+	if cancel, ok := r.followSessions[chatID]; ok {
+		cancel()
+		delete(r.followSessions, chatID)
+	}
+}
+
+// follow streams a container's logs until /unfollow, the configured
+// FollowMaxDuration elapses, or the stream ends. There's no inline-keyboard
+// Stop button: Backend's only interactive primitive is PromptChoice, a
+// one-shot blocking question, and an XMPP-compatible abstraction has no
+// equivalent of a persistent button attached to an already-sent message, so
+// /unfollow is the supported way to stop a session early.
+func (r *Registrar) follow(ctx context.Context, chatID string, userID string, args []string) {
+	if len(args) < 1 {
+		r.reply(ctx, chatID, "Usage: /follow <container>")
+		return
+	}
+	containerName := args[0]
+
+	r.stopFollow(chatID)
+
+	followCtx, cancel := context.WithTimeout(context.Background(), r.FollowMaxDuration)
+	lines, err := docker.FollowLogs(followCtx, containerName, time.Now())
+	r.audit(userID, chatID, "/follow", containerName)
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		cancel()
+		return
+	}
+
+	msgID, err := r.Backend.SendMessage(ctx, chatID, fmt.Sprintf("Following %v... (send /unfollow to stop)", containerName))
+	if err != nil {
+		log.Println(err.Error())
+		cancel()
+		return
+	}
+
+	r.followSessionsMu.Lock()
+	r.followSessions[chatID] = cancel
+	r.followSessionsMu.Unlock()
+
+	go r.runFollow(followCtx, chatID, msgID, containerName, lines)
+}
+
+func (r *Registrar) unfollow(ctx context.Context, chatID string, userID string, args []string) {
+	r.stopFollow(chatID)
+	r.reply(ctx, chatID, "Follow stopped.")
+}
+
+func (r *Registrar) runFollow(ctx context.Context, chatID string, msgID string, containerName string, lines <-chan string) {
+	defer func() {
+		r.followSessionsMu.Lock()
+		delete(r.followSessions, chatID)
+		r.followSessionsMu.Unlock()
+	}()
+
+	ticker := time.NewTicker(followEditInterval)
+	defer ticker.Stop()
+
+	currentMsgID := msgID
+	buf := fmt.Sprintf("Following %v...\n\n", containerName)
+	dirty := false
+
+	flush := func() {
+		if !dirty {
+			return
+		}
+		newID, err := r.Backend.EditMessage(context.Background(), chatID, currentMsgID, buf)
+		if err != nil {
+			log.Println(err.Error())
+			return
+		}
+		currentMsgID = newID
+		dirty = false
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			r.reply(context.Background(), chatID, "Follow session ended.")
+			return
+		case line, ok := <-lines:
+			if !ok {
+				flush()
+				r.reply(context.Background(), chatID, "Log stream ended.")
+				return
+			}
+			candidate := buf + line + "\n"
+			if len(candidate) > followMessageLimit {
+				flush()
+				newID, err := r.Backend.SendMessage(context.Background(), chatID, line+"\n")
+				if err != nil {
+					log.Println(err.Error())
+					return
+				}
+				currentMsgID = newID
+				buf = line + "\n"
+				dirty = false
+				continue
+			}
+			buf = candidate
+			dirty = true
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (r *Registrar) stats(ctx context.Context, chatID string, userID string, args []string) {
+	resp, err := docker.AllContainerStats(ctx)
+	r.audit(userID, chatID, "/stats", "")
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	r.reply(ctx, chatID, resp)
+}
+
+func (r *Registrar) top(ctx context.Context, chatID string, userID string, args []string) {
+	names, err := docker.ListContainersNamesOnly(ctx)
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	containerName, err := r.Backend.PromptChoice(ctx, chatID, "Select container:", names)
+	if err != nil {
+		if err != ErrPromptCancelled {
+			log.Println(err.Error())
+		}
+		return
+	}
+	resp, err := docker.ContainerProcesses(ctx, containerName)
+	r.audit(userID, chatID, "/top", containerName)
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	r.reply(ctx, chatID, resp)
+}
+
+func (r *Registrar) stacks(ctx context.Context, chatID string, userID string, args []string) {
+	resp, err := docker.ListStacks(ctx)
+	r.audit(userID, chatID, "/stacks", "")
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	r.reply(ctx, chatID, resp)
+}
+
+func (r *Registrar) stackRestart(ctx context.Context, chatID string, userID string, args []string) {
+	projects, err := docker.ListStackNames(ctx)
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	project, err := r.Backend.PromptChoice(ctx, chatID, "Select stack:", projects)
+	if err != nil {
+		if err != ErrPromptCancelled {
+			log.Println(err.Error())
+		}
+		return
+	}
+	resp, err := docker.RestartStack(ctx, project)
+	r.audit(userID, chatID, "/stackrestart", project)
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	r.reply(ctx, chatID, resp)
+}
+
+func (r *Registrar) stackLogs(ctx context.Context, chatID string, userID string, args []string) {
+	projects, err := docker.ListStackNames(ctx)
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	project, err := r.Backend.PromptChoice(ctx, chatID, "Select stack:", projects)
+	if err != nil {
+		if err != ErrPromptCancelled {
+			log.Println(err.Error())
+		}
+		return
+	}
+	services, err := docker.ListStackServiceNames(ctx, project)
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	service, err := r.Backend.PromptChoice(ctx, chatID, "Select service:", append([]string{"all"}, services...))
+	if err != nil {
+		if err != ErrPromptCancelled {
+			log.Println(err.Error())
+		}
+		return
+	}
+	if service == "all" {
+		service = ""
+	}
+	resp, err := docker.StackLogs(ctx, project, service)
+	r.audit(userID, chatID, "/stacklogs", project)
+	if err != nil {
+		log.Println(err.Error())
+		r.reply(ctx, chatID, err.Error())
+		return
+	}
+	r.reply(ctx, chatID, resp)
+}
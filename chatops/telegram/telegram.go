@@ -0,0 +1,279 @@
+// Package telegram implements chatops.Backend on top of the Telegram Bot
+// API.
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbot "github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/go-telegram/ui/keyboard/reply"
+	"github.com/joho/godotenv"
+
+	"github.com/pgulb/docker-chatops/chatops"
+)
+
+const promptTimeout = 2 * time.Minute
+
+// commandsWithArgs take their argument inline in the command message itself
+// (e.g. "/follow web"), rather than through a PromptChoice follow-up.
+var commandsWithArgs = map[string]bool{
+	"/ban":    true,
+	"/unban":  true,
+	"/follow": true,
+}
+
+// Backend is a chatops.Backend backed by the Telegram Bot API.
+type Backend struct {
+	bot            *tgbot.Bot
+	token          string
+	allowedChatIds []int64
+	handlers       map[string]chatops.CommandHandler
+
+	promptsMu sync.Mutex
+	prompts   map[int64]chan string
+}
+
+// New builds a Telegram backend from TELEGRAM_BOT_TOKEN and ALLOWED_CHAT_IDS
+// in the environment, loading a ".env" file first if one is present.
+func New() (*Backend, error) {
+	_ = godotenv.Load(".env")
+	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("TELEGRAM_BOT_TOKEN is empty")
+	}
+	allowedChatIds, err := parseIDList(os.Getenv("ALLOWED_CHAT_IDS"))
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{
+		token:          token,
+		allowedChatIds: allowedChatIds,
+		handlers:       make(map[string]chatops.CommandHandler),
+		prompts:        make(map[int64]chan string),
+	}, nil
+}
+
+// AdminUserIDs returns the ids from ADMIN_CHAT_IDS allowed to run /ban and
+// /unban, rendered as the backend-native strings chatops.Registrar expects.
+func AdminUserIDs() ([]string, error) {
+	ids, err := parseIDList(os.Getenv("ADMIN_CHAT_IDS"))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = strconv.FormatInt(id, 10)
+	}
+	return out, nil
+}
+
+func parseIDList(raw string) ([]int64, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var ids []int64
+	for _, s := range strings.Split(raw, ",") {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q: %w", s, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// SendMessage implements chatops.Backend.
+func (t *Backend) SendMessage(ctx context.Context, chatID string, text string) (string, error) {
+	id, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	sent, err := t.bot.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID: id,
+		Text:   text,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(sent.ID), nil
+}
+
+// EditMessage implements chatops.Backend.
+func (t *Backend) EditMessage(ctx context.Context, chatID string, messageID string, text string) (string, error) {
+	id, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	msgID, err := strconv.Atoi(messageID)
+	if err != nil {
+		return "", err
+	}
+	_, err = t.bot.EditMessageText(ctx, &tgbot.EditMessageTextParams{
+		ChatID:    id,
+		MessageID: msgID,
+		Text:      text,
+	})
+	if err != nil {
+		return "", err
+	}
+	return messageID, nil
+}
+
+// RegisterCommand implements chatops.Backend.
+func (t *Backend) RegisterCommand(name string, handler chatops.CommandHandler) {
+	t.handlers[name] = handler
+}
+
+// Authorize implements chatops.Backend. A chat may run commands if its id is
+// listed in ALLOWED_CHAT_IDS; in a private chat with the bot this is the
+// same id as the user sending the command.
+func (t *Backend) Authorize(chatID string) bool {
+	for _, id := range t.allowedChatIds {
+		if strconv.FormatInt(id, 10) == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+// PromptChoice implements chatops.Backend using a one-time reply keyboard,
+// blocking until the user taps an option, the prompt times out, or ctx is
+// cancelled.
+func (t *Backend) PromptChoice(ctx context.Context, chatID string, prompt string, options []string) (string, error) {
+	id, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return "", err
+	}
+
+	resultCh := make(chan string, 1)
+	t.promptsMu.Lock()
+	if old, ok := t.prompts[id]; ok {
+		close(old)
+	}
+	t.prompts[id] = resultCh
+	t.promptsMu.Unlock()
+
+	const cancelLabel = "Cancel"
+	kb := reply.New(
+		t.bot,
+		reply.WithPrefix(fmt.Sprintf("prompt_%d_%d", id, time.Now().UnixNano())),
+		reply.IsSelective(),
+		reply.IsOneTimeKeyboard(),
+	)
+	for _, opt := range options {
+		label := opt
+		kb.Button(label, t.bot, tgbot.MatchTypeExact, func(ctx context.Context, b *tgbot.Bot, update *models.Update) {
+			t.resolvePrompt(id, resultCh, label)
+		})
+		kb.Row()
+	}
+	kb.Button(cancelLabel, t.bot, tgbot.MatchTypeExact, func(ctx context.Context, b *tgbot.Bot, update *models.Update) {
+		t.resolvePrompt(id, resultCh, "")
+	})
+
+	if _, err := t.bot.SendMessage(ctx, &tgbot.SendMessageParams{
+		ChatID:      id,
+		Text:        prompt,
+		ReplyMarkup: kb,
+	}); err != nil {
+		return "", err
+	}
+
+	select {
+	case choice, ok := <-resultCh:
+		if !ok || choice == "" {
+			return "", chatops.ErrPromptCancelled
+		}
+		return choice, nil
+	case <-time.After(promptTimeout):
+		t.clearPrompt(id, resultCh)
+		return "", chatops.ErrPromptCancelled
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (t *Backend) resolvePrompt(chatID int64, ch chan string, choice string) {
+	t.promptsMu.Lock()
+	defer t.promptsMu.Unlock()
+	if current, ok := t.prompts[chatID]; ok && current == ch {
+		delete(t.prompts, chatID)
+		select {
+		case ch <- choice:
+		default:
+		}
+	}
+}
+
+func (t *Backend) clearPrompt(chatID int64, ch chan string) {
+	t.promptsMu.Lock()
+	defer t.promptsMu.Unlock()
+	if current, ok := t.prompts[chatID]; ok && current == ch {
+		delete(t.prompts, chatID)
+	}
+}
+
+func (t *Backend) logMessage(next tgbot.HandlerFunc) tgbot.HandlerFunc {
+	return func(ctx context.Context, b *tgbot.Bot, update *models.Update) {
+		if update.Message != nil {
+			log.Printf("%d say: %s", update.Message.From.ID, update.Message.Text)
+		}
+		next(ctx, b, update)
+	}
+}
+
+func (t *Backend) wrap(handler chatops.CommandHandler) tgbot.HandlerFunc {
+	return func(ctx context.Context, b *tgbot.Bot, update *models.Update) {
+		if update.Message == nil {
+			return
+		}
+		chatID := strconv.FormatInt(update.Message.Chat.ID, 10)
+		userID := strconv.FormatInt(update.Message.From.ID, 10)
+		var args []string
+		if fields := strings.Fields(update.Message.Text); len(fields) > 1 {
+			args = fields[1:]
+		}
+		handler(ctx, chatID, userID, args)
+	}
+}
+
+func (t *Backend) messageAll(ctx context.Context, text string) {
+	for _, id := range t.allowedChatIds {
+		if _, err := t.bot.SendMessage(ctx, &tgbot.SendMessageParams{ChatID: id, Text: text}); err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
+
+// Start implements chatops.Backend.
+func (t *Backend) Start(ctx context.Context) error {
+	opts := []tgbot.Option{
+		tgbot.WithMiddlewares(t.logMessage),
+	}
+	b, err := tgbot.New(t.token, opts...)
+	if err != nil {
+		return err
+	}
+	t.bot = b
+
+	for name, handler := range t.handlers {
+		matchType := tgbot.MatchTypeExact
+		if commandsWithArgs[name] {
+			matchType = tgbot.MatchTypePrefix
+		}
+		b.RegisterHandler(tgbot.HandlerTypeMessageText, name, matchType, t.wrap(handler))
+	}
+
+	log.Println("*** Chatops bot started (telegram) ***")
+	t.messageAll(ctx, "*Chatops bot started*")
+	b.Start(ctx)
+	return nil
+}
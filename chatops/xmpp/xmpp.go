@@ -0,0 +1,273 @@
+// Package xmpp implements chatops.Backend over an XMPP connection using
+// mellium.im/xmpp, so docker-chatops can run on self-hosted XMPP (or Matrix,
+// via an XMPP gateway) infrastructure without ever touching Telegram
+// credentials.
+package xmpp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mellium.im/sasl"
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/mux"
+	"mellium.im/xmpp/stanza"
+
+	"github.com/pgulb/docker-chatops/chatops"
+)
+
+const promptTimeout = 2 * time.Minute
+
+// Backend is a chatops.Backend backed by an XMPP connection. Chat and user
+// ids are both rendered as bare or full JIDs.
+type Backend struct {
+	session     *xmpp.Session
+	address     jid.JID
+	password    string
+	allowedJIDs []string
+	handlers    map[string]chatops.CommandHandler
+
+	msgID atomic.Int64
+
+	promptsMu sync.Mutex
+	prompts   map[string]*pendingPrompt
+}
+
+type pendingPrompt struct {
+	options []string
+	result  chan string
+}
+
+// New builds an XMPP backend from XMPP_JID, XMPP_PASSWORD, and
+// XMPP_ALLOWED_JIDS in the environment.
+func New() (*Backend, error) {
+	address := os.Getenv("XMPP_JID")
+	if address == "" {
+		return nil, fmt.Errorf("XMPP_JID is empty")
+	}
+	addr, err := jid.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XMPP_JID %q: %w", address, err)
+	}
+	password := os.Getenv("XMPP_PASSWORD")
+	if password == "" {
+		return nil, fmt.Errorf("XMPP_PASSWORD is empty")
+	}
+	var allowed []string
+	if raw := os.Getenv("XMPP_ALLOWED_JIDS"); raw != "" {
+		allowed = strings.Split(raw, ",")
+	}
+	return &Backend{
+		address:     addr,
+		password:    password,
+		allowedJIDs: allowed,
+		handlers:    make(map[string]chatops.CommandHandler),
+		prompts:     make(map[string]*pendingPrompt),
+	}, nil
+}
+
+// RegisterCommand implements chatops.Backend.
+func (x *Backend) RegisterCommand(name string, handler chatops.CommandHandler) {
+	x.handlers[name] = handler
+}
+
+// Authorize implements chatops.Backend.
+func (x *Backend) Authorize(chatID string) bool {
+	for _, allowed := range x.allowedJIDs {
+		if allowed == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+// SendMessage implements chatops.Backend, returning an id new EditMessage
+// calls can later reference via XEP-0308 message correction.
+func (x *Backend) SendMessage(ctx context.Context, chatID string, text string) (string, error) {
+	to, err := jid.Parse(chatID)
+	if err != nil {
+		return "", err
+	}
+	id := strconv.FormatInt(x.msgID.Add(1), 10)
+	if err := x.send(ctx, to, id, "", text); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// EditMessage implements chatops.Backend using XEP-0308 last message
+// correction: it sends a new message replacing messageID and returns the new
+// message's id, which callers must use for any further edits.
+func (x *Backend) EditMessage(ctx context.Context, chatID string, messageID string, text string) (string, error) {
+	to, err := jid.Parse(chatID)
+	if err != nil {
+		return "", err
+	}
+	id := strconv.FormatInt(x.msgID.Add(1), 10)
+	if err := x.send(ctx, to, id, messageID, text); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (x *Backend) send(ctx context.Context, to jid.JID, id string, replaces string, text string) error {
+	msg := stanza.Message{To: to, ID: id, Type: stanza.ChatMessage}
+	body := chatMessage{Message: msg, Body: text}
+	if replaces != "" {
+		body.Replace = &replace{ID: replaces}
+	}
+	return x.session.Encode(ctx, body)
+}
+
+// chatMessage is a <message/> stanza with a plain-text body and an optional
+// XEP-0308 <replace/> element.
+type chatMessage struct {
+	stanza.Message
+	Body    string   `xml:"body"`
+	Replace *replace `xml:"urn:xmpp:message-correct:0 replace,omitempty"`
+}
+
+type replace struct {
+	ID string `xml:"id,attr"`
+}
+
+// PromptChoice implements chatops.Backend as a numbered-choice text prompt,
+// blocking until the user's next reply, the prompt times out, or ctx is
+// cancelled. A reply that is not a listed number ends the prompt with
+// ErrPromptCancelled, just as "cancel" does.
+func (x *Backend) PromptChoice(ctx context.Context, chatID string, prompt string, options []string) (string, error) {
+	var b strings.Builder
+	b.WriteString(prompt)
+	b.WriteString("\n")
+	for i, opt := range options {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, opt)
+	}
+	b.WriteString("Reply with a number, or \"cancel\".")
+
+	result := make(chan string, 1)
+	p := &pendingPrompt{options: options, result: result}
+	x.promptsMu.Lock()
+	if old, ok := x.prompts[chatID]; ok {
+		close(old.result)
+	}
+	x.prompts[chatID] = p
+	x.promptsMu.Unlock()
+
+	if _, err := x.SendMessage(ctx, chatID, b.String()); err != nil {
+		x.clearPrompt(chatID, p)
+		return "", err
+	}
+
+	select {
+	case choice, ok := <-result:
+		if !ok || choice == "" {
+			return "", chatops.ErrPromptCancelled
+		}
+		return choice, nil
+	case <-time.After(promptTimeout):
+		x.clearPrompt(chatID, p)
+		return "", chatops.ErrPromptCancelled
+	case <-ctx.Done():
+		x.clearPrompt(chatID, p)
+		return "", ctx.Err()
+	}
+}
+
+// clearPrompt evicts p if it is still the pending prompt for chatID, leaving
+// a newer prompt that has since superseded it untouched.
+func (x *Backend) clearPrompt(chatID string, p *pendingPrompt) {
+	x.promptsMu.Lock()
+	defer x.promptsMu.Unlock()
+	if current, ok := x.prompts[chatID]; ok && current == p {
+		delete(x.prompts, chatID)
+	}
+}
+
+// handleMessage resolves a pending PromptChoice, or dispatches a command.
+// from is bared before use: Authorize and XMPP_ALLOWED_JIDS both deal in
+// bare JIDs, but a real client's "from" carries a /resource suffix. Commands
+// run in their own goroutine so a handler blocked in PromptChoice (waiting on
+// the user's next message) never wedges the session's serial read loop.
+func (x *Backend) handleMessage(from jid.JID, text string) {
+	chatID := from.Bare().String()
+
+	x.promptsMu.Lock()
+	p, waiting := x.prompts[chatID]
+	if waiting {
+		delete(x.prompts, chatID)
+	}
+	x.promptsMu.Unlock()
+
+	if waiting {
+		reply := strings.TrimSpace(text)
+		if strings.EqualFold(reply, "cancel") {
+			close(p.result)
+			return
+		}
+		n, err := strconv.Atoi(reply)
+		if err != nil || n < 1 || n > len(p.options) {
+			p.result <- ""
+			return
+		}
+		p.result <- p.options[n-1]
+		return
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return
+	}
+	handler, ok := x.handlers[fields[0]]
+	if !ok {
+		return
+	}
+	go handler(context.Background(), chatID, chatID, fields[1:])
+}
+
+// Start implements chatops.Backend.
+func (x *Backend) Start(ctx context.Context) error {
+	dialer := xmpp.Dialer{}
+	conn, err := dialer.Dial(ctx, "tcp", x.address)
+	if err != nil {
+		return err
+	}
+	session, err := xmpp.NewSession(
+		ctx, x.address.Domain(), x.address, conn,
+		0,
+		xmpp.NewNegotiator(xmpp.StreamConfig{
+			Features: []xmpp.StreamFeature{
+				xmpp.StartTLS(&tls.Config{ServerName: x.address.Domain().String()}),
+				xmpp.SASL("", x.password, sasl.Plain),
+				xmpp.BindResource(),
+			},
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	x.session = session
+	defer session.Close()
+
+	h := mux.New(
+		stanza.NSClient,
+		mux.MessageFunc("chat", stanza.Message{}.TagName(), func(_ stanza.Message, t *struct {
+			From jid.JID `xml:"from,attr"`
+			Body string  `xml:"body"`
+		}) error {
+			x.handleMessage(t.From, t.Body)
+			return nil
+		}),
+	)
+
+	log.Println("*** Chatops bot started (xmpp) ***")
+	return session.Serve(h)
+}
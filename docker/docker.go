@@ -1,20 +1,60 @@
 package docker
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math"
+	"net/http"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/docker/cli/cli/connhelper"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 )
 
+// newClient builds a Docker API client the same way the Docker CLI does:
+// DOCKER_HOST (tcp://, unix://) and TLS settings (DOCKER_TLS_VERIFY,
+// DOCKER_CERT_PATH) are honored via client.FromEnv. DOCKER_HOST=ssh://user@host
+// is handled separately: the Docker client has no built-in transport for it, so
+// we shell out to a connhelper, the same ssh-tunneling helper the Docker CLI
+// itself uses, and dial through that instead. Set CHATOPS_INSECURE_TLS=1 to
+// skip TLS certificate verification against a remote tcp daemon; this is
+// opt-in because the previous default of always skipping it is unsafe.
+func newClient() (*client.Client, error) {
+	if host := os.Getenv("DOCKER_HOST"); strings.HasPrefix(host, "ssh://") {
+		helper, err := connhelper.GetConnectionHelper(host)
+		if err != nil {
+			return nil, err
+		}
+		return client.NewClientWithOpts(
+			client.WithHost(helper.Host),
+			client.WithDialContext(helper.Dialer),
+		)
+	}
+
+	opts := []client.Opt{client.FromEnv}
+	if os.Getenv("CHATOPS_INSECURE_TLS") == "1" {
+		opts = append(opts, client.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}))
+	} else {
+		opts = append(opts, client.WithTLSClientConfigFromEnv())
+	}
+	return client.NewClientWithOpts(opts...)
+}
+
 func ListContainers(ctx context.Context) (string, error) {
-	apiClient, err := client.NewClientWithOpts(client.FromEnv)
+	apiClient, err := newClient()
 	if err != nil {
 		return "", err
 	}
@@ -58,7 +98,7 @@ func ListContainers(ctx context.Context) (string, error) {
 }
 
 func ListContainersNamesOnly(ctx context.Context) ([]string, error) {
-	apiClient, err := client.NewClientWithOpts(client.FromEnv)
+	apiClient, err := newClient()
 	if err != nil {
 		return nil, err
 	}
@@ -81,8 +121,32 @@ func ListContainersNamesOnly(ctx context.Context) ([]string, error) {
 	return resp, nil
 }
 
+func ListRunningContainerNames(ctx context.Context) ([]string, error) {
+	apiClient, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	defer apiClient.Close()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	containers, err := apiClient.ContainerList(ctxTimeout, container.ListOptions{All: false})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []string
+	for _, ctr := range containers {
+		resp = append(
+			resp,
+			ctr.Names...,
+		)
+	}
+	return resp, nil
+}
+
 func TailLogs(ctx context.Context, containerName string) (string, error) {
-	apiClient, err := client.NewClientWithOpts(client.FromEnv)
+	apiClient, err := newClient()
 	if err != nil {
 		return "", err
 	}
@@ -112,8 +176,63 @@ func TailLogs(ctx context.Context, containerName string) (string, error) {
 	return logs, nil
 }
 
+// FollowLogs tails containerName's logs starting at since and keeps streaming
+// new lines until ctx is cancelled or the log stream ends. The returned
+// channel is closed when following stops; the caller must drain it to avoid
+// leaking the underlying goroutines.
+func FollowLogs(ctx context.Context, containerName string, since time.Time) (<-chan string, error) {
+	apiClient, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	logsRaw, err := apiClient.ContainerLogs(
+		ctx,
+		containerName,
+		container.LogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Follow:     true,
+			Since:      since.Format(time.RFC3339Nano),
+		},
+	)
+	if err != nil {
+		apiClient.Close()
+		return nil, err
+	}
+
+	lines := make(chan string)
+	pr, pw := io.Pipe()
+
+	go func() {
+		_, err := stdcopy.StdCopy(pw, pw, logsRaw)
+		pw.CloseWithError(err)
+	}()
+
+	go func() {
+		defer close(lines)
+		defer logsRaw.Close()
+		defer apiClient.Close()
+		// CloseWithError unblocks the StdCopy goroutine above if it's mid-Write
+		// to pw when we stop reading, instead of leaving it (and the client)
+		// stuck forever.
+		defer pr.CloseWithError(ctx.Err())
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return lines, nil
+}
+
 func RestartContainer(ctx context.Context, containerName string) (string, error) {
-	apiClient, err := client.NewClientWithOpts(client.FromEnv)
+	apiClient, err := newClient()
 	if err != nil {
 		return "", err
 	}
@@ -144,7 +263,7 @@ func prettyByteSize(b int) string {
 }
 
 func GetImages(ctx context.Context) (string, error) {
-	apiClient, err := client.NewClientWithOpts(client.FromEnv)
+	apiClient, err := newClient()
 	if err != nil {
 		return "", err
 	}
@@ -189,7 +308,7 @@ Size: %v
 }
 
 func GetDockerVersion(ctx context.Context) (string, error) {
-	apiClient, err := client.NewClientWithOpts(client.FromEnv)
+	apiClient, err := newClient()
 	if err != nil {
 		return "", err
 	}
@@ -203,3 +322,134 @@ func GetDockerVersion(ctx context.Context) (string, error) {
 	}
 	return version.Version, nil
 }
+
+// ContainerStatsSummary is the computed subset of container.StatsResponse
+// that the bot reports through /stats.
+type ContainerStatsSummary struct {
+	Name       string
+	CPUPercent float64
+	MemUsage   uint64
+	MemLimit   uint64
+	MemPercent float64
+	NetRx      uint64
+	NetTx      uint64
+	Health     string
+}
+
+// ContainerStats takes a one-shot stats snapshot for containerName and
+// computes CPU%, memory usage/limit, and aggregate network RX/TX.
+func ContainerStats(ctx context.Context, containerName string) (ContainerStatsSummary, error) {
+	apiClient, err := newClient()
+	if err != nil {
+		return ContainerStatsSummary{}, err
+	}
+	defer apiClient.Close()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	statsRaw, err := apiClient.ContainerStats(ctxTimeout, containerName, false)
+	if err != nil {
+		return ContainerStatsSummary{}, err
+	}
+	defer statsRaw.Body.Close()
+
+	var stats container.StatsResponse
+	if err := json.NewDecoder(statsRaw.Body).Decode(&stats); err != nil {
+		return ContainerStatsSummary{}, err
+	}
+
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	var cpuPercent float64
+	if systemDelta > 0 && cpuDelta > 0 {
+		cpuPercent = (cpuDelta / systemDelta) * onlineCPUs * 100.0
+	}
+
+	var rx, tx uint64
+	for _, n := range stats.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+
+	var memPercent float64
+	if stats.MemoryStats.Limit > 0 {
+		memPercent = float64(stats.MemoryStats.Usage) / float64(stats.MemoryStats.Limit) * 100.0
+	}
+
+	health := "n/a"
+	inspect, err := apiClient.ContainerInspect(ctxTimeout, containerName)
+	if err == nil && inspect.State != nil && inspect.State.Health != nil {
+		health = inspect.State.Health.Status
+	}
+
+	return ContainerStatsSummary{
+		Name:       containerName,
+		CPUPercent: cpuPercent,
+		MemUsage:   stats.MemoryStats.Usage,
+		MemLimit:   stats.MemoryStats.Limit,
+		MemPercent: memPercent,
+		NetRx:      rx,
+		NetTx:      tx,
+		Health:     health,
+	}, nil
+}
+
+// AllContainerStats formats a ContainerStats summary for every running
+// container, for the /stats command.
+func AllContainerStats(ctx context.Context) (string, error) {
+	names, err := ListRunningContainerNames(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var resp []string
+	resp = append(resp, "*Container stats:*\n\n")
+	for _, name := range names {
+		stats, err := ContainerStats(ctx, name)
+		if err != nil {
+			resp = append(resp, fmt.Sprintf("%v: %v\n\n", name, err.Error()))
+			continue
+		}
+		resp = append(resp, fmt.Sprintf(
+			"Name: %v\nCPU: %.1f%%\nMem: %v / %v (%.1f%%)\nNet: rx %v, tx %v\nHealth: %v\n\n",
+			stats.Name,
+			stats.CPUPercent,
+			prettyByteSize(int(stats.MemUsage)),
+			prettyByteSize(int(stats.MemLimit)),
+			stats.MemPercent,
+			prettyByteSize(int(stats.NetRx)),
+			prettyByteSize(int(stats.NetTx)),
+			stats.Health,
+		))
+	}
+	return strings.Join(resp, ""), nil
+}
+
+// ContainerProcesses lists the processes running inside containerName, as
+// reported by the Docker daemon's top equivalent.
+func ContainerProcesses(ctx context.Context, containerName string) (string, error) {
+	apiClient, err := newClient()
+	if err != nil {
+		return "", err
+	}
+	defer apiClient.Close()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	top, err := apiClient.ContainerTop(ctxTimeout, containerName, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var resp []string
+	resp = append(resp, strings.Join(top.Titles, "\t"))
+	for _, proc := range top.Processes {
+		resp = append(resp, strings.Join(proc, "\t"))
+	}
+	return strings.Join(resp, "\n"), nil
+}
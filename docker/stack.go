@@ -0,0 +1,404 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+const (
+	composeProjectLabel   = "com.docker.compose.project"
+	composeServiceLabel   = "com.docker.compose.service"
+	composeDependsOnLabel = "com.docker.compose.depends_on"
+)
+
+// StackContainer is one service instance within a compose Stack.
+type StackContainer struct {
+	ID        string
+	Name      string
+	Service   string
+	DependsOn []string
+}
+
+// Stack groups containers sharing a com.docker.compose.project label.
+type Stack struct {
+	Project    string
+	Containers []StackContainer
+}
+
+func toStackContainer(ctr container.Summary) StackContainer {
+	name := ctr.ID
+	if len(ctr.Names) > 0 {
+		name = strings.TrimPrefix(ctr.Names[0], "/")
+	}
+	var dependsOn []string
+	if raw := ctr.Labels[composeDependsOnLabel]; raw != "" {
+		for _, dep := range strings.Split(raw, ",") {
+			if idx := strings.Index(dep, ":"); idx >= 0 {
+				dep = dep[:idx]
+			}
+			dependsOn = append(dependsOn, dep)
+		}
+	}
+	return StackContainer{
+		ID:        ctr.ID,
+		Name:      name,
+		Service:   ctr.Labels[composeServiceLabel],
+		DependsOn: dependsOn,
+	}
+}
+
+// getStack fetches every container for project using apiClient, which the
+// caller owns and closes.
+func getStack(ctx context.Context, apiClient *client.Client, project string) (Stack, error) {
+	ctxTimeout, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	containers, err := apiClient.ContainerList(ctxTimeout, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%v=%v", composeProjectLabel, project))),
+	})
+	if err != nil {
+		return Stack{}, err
+	}
+	if len(containers) == 0 {
+		return Stack{}, fmt.Errorf("no containers found for project %q", project)
+	}
+
+	stack := Stack{Project: project}
+	for _, ctr := range containers {
+		stack.Containers = append(stack.Containers, toStackContainer(ctr))
+	}
+	return stack, nil
+}
+
+// ListStacks groups all containers by compose project and formats them for
+// the /stacks command.
+func ListStacks(ctx context.Context) (string, error) {
+	apiClient, err := newClient()
+	if err != nil {
+		return "", err
+	}
+	defer apiClient.Close()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	containers, err := apiClient.ContainerList(ctxTimeout, container.ListOptions{All: true})
+	if err != nil {
+		return "", err
+	}
+
+	byProject := map[string][]StackContainer{}
+	for _, ctr := range containers {
+		project := ctr.Labels[composeProjectLabel]
+		if project == "" {
+			continue
+		}
+		byProject[project] = append(byProject[project], toStackContainer(ctr))
+	}
+
+	projects := make([]string, 0, len(byProject))
+	for project := range byProject {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+
+	var resp []string
+	resp = append(resp, "*Stacks:*\n\n")
+	for _, project := range projects {
+		var services []string
+		for _, c := range byProject[project] {
+			services = append(services, c.Service)
+		}
+		resp = append(resp, fmt.Sprintf("Project: %v\nservices: %v\n\n", project, strings.Join(services, ", ")))
+	}
+	return strings.Join(resp, ""), nil
+}
+
+// ListStackNames returns the known compose project names, for building a
+// reply keyboard.
+func ListStackNames(ctx context.Context) ([]string, error) {
+	apiClient, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	defer apiClient.Close()
+
+	ctxTimeout, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	containers, err := apiClient.ContainerList(ctxTimeout, container.ListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var projects []string
+	for _, ctr := range containers {
+		project := ctr.Labels[composeProjectLabel]
+		if project == "" || seen[project] {
+			continue
+		}
+		seen[project] = true
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+	return projects, nil
+}
+
+// ListStackServiceNames returns the service names within project, for
+// building a reply keyboard.
+func ListStackServiceNames(ctx context.Context, project string) ([]string, error) {
+	apiClient, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	defer apiClient.Close()
+
+	stack, err := getStack(ctx, apiClient, project)
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, c := range stack.Containers {
+		services = append(services, c.Service)
+	}
+	return services, nil
+}
+
+// orderByDependencies topologically sorts containers so that each service's
+// com.docker.compose.depends_on entries come before it. If the dependency
+// graph has a cycle, it logs a warning and falls back to lexical order by
+// service name.
+func orderByDependencies(containers []StackContainer) []StackContainer {
+	bySvc := make(map[string][]StackContainer, len(containers))
+	for _, c := range containers {
+		bySvc[c.Service] = append(bySvc[c.Service], c)
+	}
+
+	const (
+		unvisited = 0
+		visiting  = 1
+		done      = 2
+	)
+	state := map[string]int{}
+	var order []string
+	cyclic := false
+
+	var visit func(svc string)
+	visit = func(svc string) {
+		if cyclic || state[svc] == done {
+			return
+		}
+		if state[svc] == visiting {
+			cyclic = true
+			return
+		}
+		state[svc] = visiting
+		if cs, ok := bySvc[svc]; ok {
+			deps := append([]string{}, cs[0].DependsOn...)
+			sort.Strings(deps)
+			for _, dep := range deps {
+				visit(dep)
+			}
+		}
+		state[svc] = done
+		order = append(order, svc)
+	}
+
+	services := make([]string, 0, len(containers))
+	for _, c := range containers {
+		services = append(services, c.Service)
+	}
+	sort.Strings(services)
+	for _, svc := range services {
+		visit(svc)
+	}
+
+	if cyclic {
+		log.Println("compose depends_on cycle detected, falling back to lexical order")
+		fallback := append([]StackContainer{}, containers...)
+		sort.Slice(fallback, func(i, j int) bool { return fallback[i].Service < fallback[j].Service })
+		return fallback
+	}
+
+	ordered := make([]StackContainer, 0, len(containers))
+	for _, svc := range order {
+		ordered = append(ordered, bySvc[svc]...)
+	}
+	return ordered
+}
+
+// RestartStack restarts every container in project, respecting
+// com.docker.compose.depends_on ordering.
+func RestartStack(ctx context.Context, project string) (string, error) {
+	apiClient, err := newClient()
+	if err != nil {
+		return "", err
+	}
+	defer apiClient.Close()
+
+	stack, err := getStack(ctx, apiClient, project)
+	if err != nil {
+		return "", err
+	}
+
+	var resp []string
+	for _, c := range orderByDependencies(stack.Containers) {
+		ctxTimeout, cancel := context.WithTimeout(ctx, 60*time.Second)
+		err := apiClient.ContainerRestart(ctxTimeout, c.ID, container.StopOptions{Timeout: nil})
+		cancel()
+		if err != nil {
+			resp = append(resp, fmt.Sprintf("%v: %v", c.Name, err.Error()))
+			continue
+		}
+		resp = append(resp, fmt.Sprintf("%v: restarted", c.Name))
+	}
+	return strings.Join(resp, "\n"), nil
+}
+
+// StopStack stops every container in project, in lexical service order.
+func StopStack(ctx context.Context, project string) (string, error) {
+	apiClient, err := newClient()
+	if err != nil {
+		return "", err
+	}
+	defer apiClient.Close()
+
+	stack, err := getStack(ctx, apiClient, project)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(stack.Containers, func(i, j int) bool { return stack.Containers[i].Service < stack.Containers[j].Service })
+
+	var resp []string
+	for _, c := range stack.Containers {
+		ctxTimeout, cancel := context.WithTimeout(ctx, 60*time.Second)
+		err := apiClient.ContainerStop(ctxTimeout, c.ID, container.StopOptions{})
+		cancel()
+		if err != nil {
+			resp = append(resp, fmt.Sprintf("%v: %v", c.Name, err.Error()))
+			continue
+		}
+		resp = append(resp, fmt.Sprintf("%v: stopped", c.Name))
+	}
+	return strings.Join(resp, "\n"), nil
+}
+
+// StartStack starts every container in project, in lexical service order.
+func StartStack(ctx context.Context, project string) (string, error) {
+	apiClient, err := newClient()
+	if err != nil {
+		return "", err
+	}
+	defer apiClient.Close()
+
+	stack, err := getStack(ctx, apiClient, project)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(stack.Containers, func(i, j int) bool { return stack.Containers[i].Service < stack.Containers[j].Service })
+
+	var resp []string
+	for _, c := range stack.Containers {
+		ctxTimeout, cancel := context.WithTimeout(ctx, 60*time.Second)
+		err := apiClient.ContainerStart(ctxTimeout, c.ID, container.StartOptions{})
+		cancel()
+		if err != nil {
+			resp = append(resp, fmt.Sprintf("%v: %v", c.Name, err.Error()))
+			continue
+		}
+		resp = append(resp, fmt.Sprintf("%v: started", c.Name))
+	}
+	return strings.Join(resp, "\n"), nil
+}
+
+// StackLogs returns the tail of every container's logs in project,
+// interleaved and prefixed by service name. If service is non-empty, only
+// that service's logs are returned.
+func StackLogs(ctx context.Context, project string, service string) (string, error) {
+	apiClient, err := newClient()
+	if err != nil {
+		return "", err
+	}
+	defer apiClient.Close()
+
+	stack, err := getStack(ctx, apiClient, project)
+	if err != nil {
+		return "", err
+	}
+
+	var errs []string
+	var entries []stackLogEntry
+	for _, c := range stack.Containers {
+		if service != "" && c.Service != service {
+			continue
+		}
+		ctxTimeout, cancel := context.WithTimeout(ctx, 60*time.Second)
+		logsRaw, err := apiClient.ContainerLogs(ctxTimeout, c.ID, container.LogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Tail:       "30",
+			Timestamps: true,
+		})
+		if err != nil {
+			cancel()
+			errs = append(errs, fmt.Sprintf("[%v] %v", c.Service, err.Error()))
+			continue
+		}
+		var logsBuf bytes.Buffer
+		_, err = stdcopy.StdCopy(&logsBuf, &logsBuf, logsRaw)
+		logsRaw.Close()
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("[%v] %v", c.Service, err.Error()))
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimRight(logsBuf.String(), "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			ts, text := splitLogTimestamp(line)
+			entries = append(entries, stackLogEntry{ts: ts, service: c.Service, text: text})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].ts.Before(entries[j].ts) })
+
+	resp := errs
+	for _, e := range entries {
+		resp = append(resp, fmt.Sprintf("[%v] %v", e.service, e.text))
+	}
+	return strings.Join(resp, "\n"), nil
+}
+
+// stackLogEntry is one timestamped log line from a single container within a
+// stack, used to interleave multiple containers' logs into one timeline.
+type stackLogEntry struct {
+	ts      time.Time
+	service string
+	text    string
+}
+
+// splitLogTimestamp splits a docker log line produced with Timestamps: true
+// ("2024-01-01T00:00:00.000000000Z message...") into its timestamp and the
+// remaining text. Lines that don't parse as timestamped are returned as-is
+// with a zero time, so they still appear (just unordered relative to peers).
+func splitLogTimestamp(line string) (time.Time, string) {
+	stamp, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return time.Time{}, line
+	}
+	ts, err := time.Parse(time.RFC3339Nano, stamp)
+	if err != nil {
+		return time.Time{}, line
+	}
+	return ts, rest
+}